@@ -0,0 +1,729 @@
+package ocppj
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lorenzodonini/ocpp-go/ocpp"
+)
+
+// DefaultSweepInterval is the default interval at which a state's sweeper goroutine,
+// once started, scans for expired pending requests.
+const DefaultSweepInterval = 30 * time.Second
+
+// OnClientRequestExpired is invoked on a ClientState when a pending request's TTL elapses
+// before a matching CALLRESULT/CALLERROR was received.
+type OnClientRequestExpired func(requestID string, request ocpp.Request)
+
+// OnServerRequestExpired is invoked on a ServerState when a pending request's TTL elapses
+// before a matching CALLRESULT/CALLERROR was received from the given client.
+type OnServerRequestExpired func(clientID string, requestID string, request ocpp.Request)
+
+// OnClientQueueEvent is invoked on a queue-mode ClientState for every notable transition of a
+// queued request: OnQueueFull when it is buffered because Full() already reports true,
+// OnRequestDequeued when a freed-up slot lets it move to the front and become the new
+// in-flight request, and OnRequestDropped when it is discarded by ClearPendingRequests
+// before ever being dequeued.
+type OnClientQueueEvent func(requestID string, request ocpp.Request)
+
+// OnServerQueueEvent is the ServerState counterpart of OnClientQueueEvent, additionally
+// identifying which client the event occurred for.
+type OnServerQueueEvent func(clientID string, requestID string, request ocpp.Request)
+
+// queuedRequest is a CALL buffered in a ClientState's FIFO queue, waiting for an in-flight
+// slot to free up.
+type queuedRequest struct {
+	requestID string
+	request   ocpp.Request
+	ttl       time.Duration
+}
+
+// ClientState defines the interface for handling pending requests for a client ocppj endpoint (charging station).
+type ClientState interface {
+	HasPendingRequest() bool
+	GetPendingRequest(requestID string) (ocpp.Request, bool)
+	AddPendingRequest(requestID string, request ocpp.Request)
+	// AddPendingRequestWithTTL behaves like AddPendingRequest, but overrides the state's
+	// default TTL (set via SetRequestTTL) for this single request. A zero ttl means the
+	// request never expires.
+	AddPendingRequestWithTTL(requestID string, request ocpp.Request, ttl time.Duration)
+	DeletePendingRequest(requestID string)
+	ClearPendingRequests()
+	// SetRequestTTL sets the default TTL applied to requests added via AddPendingRequest.
+	// A zero value (the default) disables expiration.
+	SetRequestTTL(ttl time.Duration)
+	// SetRefreshOnAccess controls whether a successful GetPendingRequest resets the TTL
+	// of the retrieved entry, instead of counting down from insertion time.
+	SetRefreshOnAccess(refresh bool)
+	// SetOnRequestExpired registers the callback invoked when a pending request expires
+	// before being answered. The callback fires from the sweeper goroutine started by Start,
+	// or from GetPendingRequest when it finds the requested entry already expired.
+	SetOnRequestExpired(callback OnClientRequestExpired)
+	// SetSweepInterval overrides the interval at which the sweeper goroutine scans for
+	// expired pending requests. It must be called before Start to take effect.
+	SetSweepInterval(interval time.Duration)
+	// Start launches the background sweeper goroutine, which periodically evicts expired
+	// pending requests. Calling Start more than once without an intervening Stop is a no-op.
+	Start()
+	// Stop terminates the sweeper goroutine started by Start. It is safe to call Stop
+	// even if the sweeper was never started.
+	Stop()
+	// QueueDepth returns the total number of requests currently tracked, whether already
+	// in-flight or still buffered in the FIFO queue. Only meaningful in queue mode (see
+	// NewClientStateWithQueue); it is always 0 outside of it.
+	QueueDepth() int
+	// Full reports whether the number of in-flight (unanswered) requests has reached the
+	// max depth configured via NewClientStateWithQueue, meaning that any further
+	// AddPendingRequest call will be buffered rather than sent out immediately. Always
+	// false outside of queue mode.
+	Full() bool
+	// SetOnQueueFull registers the callback invoked when AddPendingRequest buffers a request
+	// because Full() already reports true.
+	SetOnQueueFull(callback OnClientQueueEvent)
+	// SetOnRequestDequeued registers the callback invoked when a buffered request is
+	// promoted to in-flight, because a prior in-flight request was answered or expired and
+	// freed up a slot.
+	SetOnRequestDequeued(callback OnClientQueueEvent)
+	// SetOnRequestDropped registers the callback invoked, once per request, when
+	// ClearPendingRequests discards requests that were still sitting in the FIFO queue.
+	SetOnRequestDropped(callback OnClientQueueEvent)
+}
+
+type clientState struct {
+	mutex           sync.Mutex
+	id              string
+	store           RequestStore
+	defaultTTL      time.Duration
+	refreshOnAccess bool
+	sweepInterval   time.Duration
+	onExpired       OnClientRequestExpired
+	reportExpired   func(requestID string, request ocpp.Request)
+	stopC           chan struct{}
+	running         bool
+
+	// Queue mode (see NewClientStateWithQueue). maxDepth is 0 when disabled.
+	maxDepth      int
+	inFlightCount int
+	waiting       []queuedRequest
+	onQueueFull   OnClientQueueEvent
+	onDequeued    OnClientQueueEvent
+	onDropped     OnClientQueueEvent
+}
+
+// NewClientState creates a new ClientState struct, backed by the default in-memory
+// RequestStore.
+func NewClientState() ClientState {
+	return NewClientStateWithStore(NewMemoryRequestStore())
+}
+
+// NewClientStateWithStore creates a new ClientState struct, backed by the given RequestStore.
+// This allows pending requests to be persisted outside of process memory, e.g. to survive a
+// restart.
+func NewClientStateWithStore(store RequestStore) ClientState {
+	return newClientState(store, "")
+}
+
+// NewClientStateWithQueue creates a new ClientState struct, backed by the default in-memory
+// RequestStore, with bounded FIFO queueing enabled: up to maxDepth requests may be in-flight
+// at once, and any additional request added via AddPendingRequest is buffered until an
+// in-flight slot frees up. A non-positive maxDepth disables queueing, same as NewClientState.
+func NewClientStateWithQueue(maxDepth int) ClientState {
+	s := newClientState(NewMemoryRequestStore(), "")
+	s.maxDepth = maxDepth
+	return s
+}
+
+func newClientState(store RequestStore, id string) *clientState {
+	s := &clientState{
+		store:         store,
+		id:            id,
+		sweepInterval: DefaultSweepInterval,
+	}
+	s.reportExpired = func(requestID string, request ocpp.Request) {
+		if s.onExpired != nil {
+			s.onExpired(requestID, request)
+		}
+	}
+	return s
+}
+
+func (s *clientState) HasPendingRequest() bool {
+	has := false
+	_ = s.store.IterateByClient(s.id, func(entry StoredRequest) bool {
+		has = true
+		return false
+	})
+	return has
+}
+
+func (s *clientState) GetPendingRequest(requestID string) (ocpp.Request, bool) {
+	entry, ok, err := s.store.Load(s.id, requestID)
+	if err != nil || !ok {
+		return nil, false
+	}
+	if entry.expired(time.Now()) {
+		// Atomically claim the entry before releasing its slot/reporting anything: a
+		// concurrent DeletePendingRequest for the same requestID (a real, late response)
+		// may have already removed it, in which case this call must be a no-op. Unlike
+		// DeletePendingRequest, winning this race means a pending request was never answered,
+		// so it must be reported expired exactly like sweep() would have.
+		removed, err := s.store.DeleteIfPresent(s.id, requestID)
+		if err == nil && removed {
+			s.releaseSlot()
+			s.reportExpired(entry.RequestID, entry.Request)
+		}
+		return nil, false
+	}
+	s.mutex.Lock()
+	refresh := s.refreshOnAccess
+	defaultTTL := s.defaultTTL
+	s.mutex.Unlock()
+	if refresh && entry.HasExpiry {
+		// Extend by the entry's own TTL, not the state's current default: they may differ,
+		// e.g. when this entry was added via AddPendingRequestWithTTL, or the default was
+		// changed after the entry was created. Entries persisted by a RequestStore before TTL
+		// was tracked per-entry come back with a zero TTL; fall back to the current default
+		// for those rather than collapsing their expiry to now.
+		ttl := entry.TTL
+		if ttl <= 0 {
+			ttl = defaultTTL
+		}
+		entry.ExpiresAt = time.Now().Add(ttl)
+		_ = s.store.Save(entry)
+	}
+	return entry.Request, true
+}
+
+func (s *clientState) AddPendingRequest(requestID string, request ocpp.Request) {
+	s.mutex.Lock()
+	ttl := s.defaultTTL
+	s.mutex.Unlock()
+	s.AddPendingRequestWithTTL(requestID, request, ttl)
+}
+
+func (s *clientState) AddPendingRequestWithTTL(requestID string, request ocpp.Request, ttl time.Duration) {
+	s.mutex.Lock()
+	if s.maxDepth > 0 && s.inFlightCount >= s.maxDepth {
+		s.waiting = append(s.waiting, queuedRequest{requestID: requestID, request: request, ttl: ttl})
+		onFull := s.onQueueFull
+		s.mutex.Unlock()
+		if onFull != nil {
+			onFull(requestID, request)
+		}
+		return
+	}
+	if s.maxDepth > 0 {
+		s.inFlightCount++
+	} else if s.HasPendingRequest() {
+		// Outside of queue mode only a single request may be pending at a time: further
+		// requests are ignored until the pending one is answered, expires or is cleared.
+		s.mutex.Unlock()
+		return
+	}
+	s.mutex.Unlock()
+	s.saveInFlight(requestID, request, ttl)
+}
+
+func (s *clientState) saveInFlight(requestID string, request ocpp.Request, ttl time.Duration) {
+	entry, err := NewStoredRequest(s.id, requestID, request)
+	if err != nil {
+		// The request isn't JSON-serializable: still keep it around in memory, just without
+		// a durable Payload/Action for a remote RequestStore to fall back on.
+		entry = StoredRequest{ClientID: s.id, RequestID: requestID, Timestamp: time.Now(), Request: request}
+	}
+	if ttl > 0 {
+		entry.HasExpiry = true
+		entry.TTL = ttl
+		entry.ExpiresAt = time.Now().Add(ttl)
+	}
+	_ = s.store.Save(entry)
+}
+
+func (s *clientState) DeletePendingRequest(requestID string) {
+	// Only release a queue slot if this call is the one that actually removed the entry:
+	// a duplicate delete, or one racing against the sweeper expiring the same requestID,
+	// must not free a slot twice.
+	removed, err := s.store.DeleteIfPresent(s.id, requestID)
+	if err == nil && removed {
+		s.releaseSlot()
+	}
+}
+
+// releaseSlot accounts for an in-flight request that was just answered, expired, or removed,
+// promoting the next buffered request (if any) into its place. It is a no-op outside of
+// queue mode.
+func (s *clientState) releaseSlot() {
+	s.mutex.Lock()
+	if s.maxDepth <= 0 {
+		s.mutex.Unlock()
+		return
+	}
+	if s.inFlightCount > 0 {
+		s.inFlightCount--
+	}
+	if len(s.waiting) == 0 {
+		s.mutex.Unlock()
+		return
+	}
+	next := s.waiting[0]
+	s.waiting = s.waiting[1:]
+	s.inFlightCount++
+	onDequeued := s.onDequeued
+	s.mutex.Unlock()
+
+	s.saveInFlight(next.requestID, next.request, next.ttl)
+	if onDequeued != nil {
+		onDequeued(next.requestID, next.request)
+	}
+}
+
+func (s *clientState) ClearPendingRequests() {
+	var requestIDs []string
+	_ = s.store.IterateByClient(s.id, func(entry StoredRequest) bool {
+		requestIDs = append(requestIDs, entry.RequestID)
+		return true
+	})
+	for _, requestID := range requestIDs {
+		_ = s.store.Delete(s.id, requestID)
+	}
+
+	s.mutex.Lock()
+	dropped := s.waiting
+	s.waiting = nil
+	s.inFlightCount = 0
+	onDropped := s.onDropped
+	s.mutex.Unlock()
+
+	if onDropped != nil {
+		for _, q := range dropped {
+			onDropped(q.requestID, q.request)
+		}
+	}
+}
+
+func (s *clientState) SetRequestTTL(ttl time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.defaultTTL = ttl
+}
+
+func (s *clientState) SetRefreshOnAccess(refresh bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.refreshOnAccess = refresh
+}
+
+func (s *clientState) SetOnRequestExpired(callback OnClientRequestExpired) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.onExpired = callback
+}
+
+func (s *clientState) SetSweepInterval(interval time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if interval > 0 {
+		s.sweepInterval = interval
+	}
+}
+
+func (s *clientState) QueueDepth() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.maxDepth <= 0 {
+		return 0
+	}
+	return s.inFlightCount + len(s.waiting)
+}
+
+func (s *clientState) Full() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.maxDepth > 0 && s.inFlightCount >= s.maxDepth
+}
+
+func (s *clientState) SetOnQueueFull(callback OnClientQueueEvent) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.onQueueFull = callback
+}
+
+func (s *clientState) SetOnRequestDequeued(callback OnClientQueueEvent) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.onDequeued = callback
+}
+
+func (s *clientState) SetOnRequestDropped(callback OnClientQueueEvent) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.onDropped = callback
+}
+
+func (s *clientState) Start() {
+	s.mutex.Lock()
+	if s.running {
+		s.mutex.Unlock()
+		return
+	}
+	s.running = true
+	s.stopC = make(chan struct{})
+	stopC := s.stopC
+	interval := s.sweepInterval
+	s.mutex.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.sweep()
+			case <-stopC:
+				return
+			}
+		}
+	}()
+}
+
+func (s *clientState) Stop() {
+	s.mutex.Lock()
+	if !s.running {
+		s.mutex.Unlock()
+		return
+	}
+	s.running = false
+	close(s.stopC)
+	s.mutex.Unlock()
+}
+
+// sweep evicts expired pending requests, invoking the registered callback for each of them.
+// It is safe to call concurrently with any other ClientState method, including
+// ClearPendingRequests.
+func (s *clientState) sweep() {
+	now := time.Now()
+	var expired []StoredRequest
+	_ = s.store.IterateByClient(s.id, func(entry StoredRequest) bool {
+		if entry.expired(now) {
+			expired = append(expired, entry)
+		}
+		return true
+	})
+	for _, entry := range expired {
+		// The snapshot above may be stale by the time we get here: a concurrent
+		// DeletePendingRequest may have already claimed this requestID with a real
+		// CALLRESULT/CALLERROR. Only release the slot and report expiry if this call is the
+		// one that actually removed the entry, so a genuinely-answered request is never
+		// reported as expired.
+		removed, err := s.store.DeleteIfPresent(s.id, entry.RequestID)
+		if err != nil || !removed {
+			continue
+		}
+		s.releaseSlot()
+		s.reportExpired(entry.RequestID, entry.Request)
+	}
+}
+
+// ServerState defines the interface for handling pending requests for all clients connected to an ocppj server (central system).
+type ServerState interface {
+	HasPendingRequests() bool
+	HasPendingRequest(clientID string) bool
+	AddPendingRequest(clientID string, requestID string, request ocpp.Request)
+	// AddPendingRequestWithTTL behaves like AddPendingRequest, but overrides the default
+	// per-client TTL (set via SetRequestTTL) for this single request.
+	AddPendingRequestWithTTL(clientID string, requestID string, request ocpp.Request, ttl time.Duration)
+	DeletePendingRequest(clientID string, requestID string)
+	ClearClientPendingRequest(clientID string)
+	ClearAllPendingRequests()
+	GetClientState(clientID string) ClientState
+	// SetRequestTTL sets the default TTL applied to requests added for any client.
+	SetRequestTTL(ttl time.Duration)
+	// SetRefreshOnAccess controls whether retrieving a pending request resets its TTL.
+	SetRefreshOnAccess(refresh bool)
+	// SetOnRequestExpired registers the callback invoked when a pending request expires
+	// before being answered, for any client.
+	SetOnRequestExpired(callback OnServerRequestExpired)
+	// SetSweepInterval overrides the sweep interval applied to every known client state, as
+	// well as any client state created afterwards. It must be called before Start to take
+	// effect on already-running sweepers.
+	SetSweepInterval(interval time.Duration)
+	// Start launches the background sweeper goroutine for every known client state, as
+	// well as any client state created afterwards.
+	Start()
+	// Stop terminates the sweeper goroutines started by Start.
+	Stop()
+	// QueueDepth returns the total number of requests currently tracked for clientID,
+	// whether already in-flight or still buffered in its FIFO queue. Only meaningful in
+	// queue mode (see NewServerStateWithQueue); it is always 0 outside of it.
+	QueueDepth(clientID string) int
+	// Full reports whether clientID's number of in-flight (unanswered) requests has reached
+	// the max depth configured via NewServerStateWithQueue. Always false outside of queue
+	// mode.
+	Full(clientID string) bool
+	// SetOnQueueFull registers the callback invoked when AddPendingRequest buffers a request
+	// for some client because Full(clientID) already reports true.
+	SetOnQueueFull(callback OnServerQueueEvent)
+	// SetOnRequestDequeued registers the callback invoked when a buffered request for some
+	// client is promoted to in-flight.
+	SetOnRequestDequeued(callback OnServerQueueEvent)
+	// SetOnRequestDropped registers the callback invoked, once per request, when
+	// ClearClientPendingRequest or ClearAllPendingRequests discards requests that were still
+	// sitting in a client's FIFO queue.
+	SetOnRequestDropped(callback OnServerQueueEvent)
+}
+
+type serverState struct {
+	mutex           *sync.RWMutex
+	store           RequestStore
+	clientStates    map[string]*clientState
+	defaultTTL      time.Duration
+	refreshOnAccess bool
+	sweepInterval   time.Duration
+	onExpired       OnServerRequestExpired
+	running         bool
+
+	// Queue mode (see NewServerStateWithQueue). maxDepth is 0 when disabled.
+	maxDepth    int
+	onQueueFull OnServerQueueEvent
+	onDequeued  OnServerQueueEvent
+	onDropped   OnServerQueueEvent
+}
+
+// NewServerState creates a new ServerState struct, backed by the default in-memory
+// RequestStore. A mutex may be passed, to synchronize access to the state with other
+// operations. If no mutex is passed, a new one will be created.
+func NewServerState(mutex *sync.RWMutex) ServerState {
+	return NewServerStateWithStore(NewMemoryRequestStore(), mutex)
+}
+
+// NewServerStateWithStore creates a new ServerState struct, backed by the given RequestStore.
+// This allows pending requests for all connected clients to be persisted outside of process
+// memory, e.g. to survive a restart or to be shared across a horizontally scaled CSMS. A
+// mutex may be passed, to synchronize access to the state with other operations. If no
+// mutex is passed, a new one will be created.
+func NewServerStateWithStore(store RequestStore, mutex *sync.RWMutex) ServerState {
+	if mutex == nil {
+		mutex = &sync.RWMutex{}
+	}
+	return &serverState{
+		mutex:        mutex,
+		store:        store,
+		clientStates: map[string]*clientState{},
+	}
+}
+
+// NewServerStateWithQueue creates a new ServerState struct, backed by the default in-memory
+// RequestStore, with bounded FIFO queueing enabled for every client: up to maxDepth requests
+// may be in-flight per client at once, and any additional request added for that client via
+// AddPendingRequest is buffered until one of its in-flight slots frees up. A non-positive
+// maxDepth disables queueing, same as NewServerState. A mutex may be passed, to synchronize
+// access to the state with other operations. If no mutex is passed, a new one will be
+// created.
+func NewServerStateWithQueue(maxDepth int, mutex *sync.RWMutex) ServerState {
+	s := NewServerStateWithStore(NewMemoryRequestStore(), mutex).(*serverState)
+	s.maxDepth = maxDepth
+	return s
+}
+
+// getOrCreateClientState returns the clientState for the given clientID, creating it if
+// necessary. Callers must hold s.mutex.
+func (s *serverState) getOrCreateClientState(clientID string) *clientState {
+	cs, ok := s.clientStates[clientID]
+	if !ok {
+		cs = newClientState(s.store, clientID)
+		cs.defaultTTL = s.defaultTTL
+		cs.refreshOnAccess = s.refreshOnAccess
+		cs.maxDepth = s.maxDepth
+		if s.sweepInterval > 0 {
+			cs.sweepInterval = s.sweepInterval
+		}
+		cs.reportExpired = func(requestID string, request ocpp.Request) {
+			if s.onExpired != nil {
+				s.onExpired(clientID, requestID, request)
+			}
+		}
+		cs.onQueueFull = func(requestID string, request ocpp.Request) {
+			if s.onQueueFull != nil {
+				s.onQueueFull(clientID, requestID, request)
+			}
+		}
+		cs.onDequeued = func(requestID string, request ocpp.Request) {
+			if s.onDequeued != nil {
+				s.onDequeued(clientID, requestID, request)
+			}
+		}
+		cs.onDropped = func(requestID string, request ocpp.Request) {
+			if s.onDropped != nil {
+				s.onDropped(clientID, requestID, request)
+			}
+		}
+		s.clientStates[clientID] = cs
+		if s.running {
+			cs.Start()
+		}
+	}
+	return cs
+}
+
+func (s *serverState) HasPendingRequests() bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for _, cs := range s.clientStates {
+		if cs.HasPendingRequest() {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *serverState) HasPendingRequest(clientID string) bool {
+	s.mutex.RLock()
+	cs, ok := s.clientStates[clientID]
+	s.mutex.RUnlock()
+	if !ok {
+		return false
+	}
+	return cs.HasPendingRequest()
+}
+
+func (s *serverState) AddPendingRequest(clientID string, requestID string, request ocpp.Request) {
+	s.mutex.Lock()
+	cs := s.getOrCreateClientState(clientID)
+	s.mutex.Unlock()
+	cs.AddPendingRequest(requestID, request)
+}
+
+func (s *serverState) AddPendingRequestWithTTL(clientID string, requestID string, request ocpp.Request, ttl time.Duration) {
+	s.mutex.Lock()
+	cs := s.getOrCreateClientState(clientID)
+	s.mutex.Unlock()
+	cs.AddPendingRequestWithTTL(requestID, request, ttl)
+}
+
+func (s *serverState) DeletePendingRequest(clientID string, requestID string) {
+	s.mutex.RLock()
+	cs, ok := s.clientStates[clientID]
+	s.mutex.RUnlock()
+	if !ok {
+		return
+	}
+	cs.DeletePendingRequest(requestID)
+}
+
+func (s *serverState) ClearClientPendingRequest(clientID string) {
+	s.mutex.RLock()
+	cs, ok := s.clientStates[clientID]
+	s.mutex.RUnlock()
+	if !ok {
+		return
+	}
+	cs.ClearPendingRequests()
+}
+
+func (s *serverState) ClearAllPendingRequests() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, cs := range s.clientStates {
+		cs.Stop()
+		cs.ClearPendingRequests()
+	}
+	s.clientStates = map[string]*clientState{}
+}
+
+func (s *serverState) GetClientState(clientID string) ClientState {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.getOrCreateClientState(clientID)
+}
+
+func (s *serverState) SetRequestTTL(ttl time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.defaultTTL = ttl
+	for _, cs := range s.clientStates {
+		cs.SetRequestTTL(ttl)
+	}
+}
+
+func (s *serverState) SetRefreshOnAccess(refresh bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.refreshOnAccess = refresh
+	for _, cs := range s.clientStates {
+		cs.SetRefreshOnAccess(refresh)
+	}
+}
+
+func (s *serverState) SetOnRequestExpired(callback OnServerRequestExpired) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.onExpired = callback
+}
+
+func (s *serverState) SetSweepInterval(interval time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if interval <= 0 {
+		return
+	}
+	s.sweepInterval = interval
+	for _, cs := range s.clientStates {
+		cs.SetSweepInterval(interval)
+	}
+}
+
+func (s *serverState) Start() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.running = true
+	for _, cs := range s.clientStates {
+		cs.Start()
+	}
+}
+
+func (s *serverState) Stop() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.running = false
+	for _, cs := range s.clientStates {
+		cs.Stop()
+	}
+}
+
+func (s *serverState) QueueDepth(clientID string) int {
+	s.mutex.RLock()
+	cs, ok := s.clientStates[clientID]
+	s.mutex.RUnlock()
+	if !ok {
+		return 0
+	}
+	return cs.QueueDepth()
+}
+
+func (s *serverState) Full(clientID string) bool {
+	s.mutex.RLock()
+	cs, ok := s.clientStates[clientID]
+	s.mutex.RUnlock()
+	if !ok {
+		return false
+	}
+	return cs.Full()
+}
+
+func (s *serverState) SetOnQueueFull(callback OnServerQueueEvent) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.onQueueFull = callback
+}
+
+func (s *serverState) SetOnRequestDequeued(callback OnServerQueueEvent) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.onDequeued = callback
+}
+
+func (s *serverState) SetOnRequestDropped(callback OnServerQueueEvent) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.onDropped = callback
+}
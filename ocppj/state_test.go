@@ -1,11 +1,17 @@
 package ocppj_test
 
 import (
+	"fmt"
 	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 
+	"github.com/lorenzodonini/ocpp-go/ocpp"
 	"github.com/lorenzodonini/ocpp-go/ocppj"
 )
 
@@ -96,6 +102,172 @@ func (suite *ClientStateTestSuite) TestClearPendingRequests() {
 	suite.False(suite.state.HasPendingRequest())
 }
 
+func (suite *ClientStateTestSuite) TestPendingRequestExpiration() {
+	requestID := "1234"
+	expired := make(chan string, 1)
+	suite.state.SetSweepInterval(10 * time.Millisecond)
+	suite.state.SetOnRequestExpired(func(requestID string, request ocpp.Request) {
+		expired <- requestID
+	})
+	suite.state.Start()
+	defer suite.state.Stop()
+	suite.state.AddPendingRequestWithTTL(requestID, newMockRequest("somevalue"), 20*time.Millisecond)
+	suite.Require().True(suite.state.HasPendingRequest())
+
+	select {
+	case id := <-expired:
+		suite.Equal(requestID, id)
+	case <-time.After(time.Second):
+		suite.Fail("expiration callback was never invoked")
+	}
+	suite.False(suite.state.HasPendingRequest())
+	r, exists := suite.state.GetPendingRequest(requestID)
+	suite.False(exists)
+	suite.Nil(r)
+}
+
+// TestLazyExpiryReportsExpiredWithoutSweeper covers the path a dispatcher actually uses to
+// match an incoming CALLRESULT/CALLERROR: GetPendingRequest discovering a request has expired
+// on its own, with no sweeper running at all. It must report the expiry exactly like sweep()
+// does, not just silently drop the entry, or a caller waiting on OnRequestExpired to know its
+// request failed would hang forever.
+func (suite *ClientStateTestSuite) TestLazyExpiryReportsExpiredWithoutSweeper() {
+	requestID := "1234"
+	expired := make(chan string, 1)
+	suite.state.SetOnRequestExpired(func(requestID string, request ocpp.Request) {
+		expired <- requestID
+	})
+	suite.state.AddPendingRequestWithTTL(requestID, newMockRequest("somevalue"), 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+
+	r, exists := suite.state.GetPendingRequest(requestID)
+	suite.False(exists)
+	suite.Nil(r)
+
+	select {
+	case id := <-expired:
+		suite.Equal(requestID, id)
+	case <-time.After(time.Second):
+		suite.Fail("expiration callback was never invoked")
+	}
+}
+
+func (suite *ClientStateTestSuite) TestPendingRequestRefreshOnAccess() {
+	requestID := "1234"
+	suite.state.SetRefreshOnAccess(true)
+	suite.state.AddPendingRequestWithTTL(requestID, newMockRequest("somevalue"), 100*time.Millisecond)
+	// Repeatedly access the request, each time within the TTL window, long enough
+	// to exceed what the TTL would have allowed without refreshing.
+	deadline := time.Now().Add(250 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		_, exists := suite.state.GetPendingRequest(requestID)
+		suite.Require().True(exists)
+		time.Sleep(20 * time.Millisecond)
+	}
+	suite.True(suite.state.HasPendingRequest())
+}
+
+func (suite *ClientStateTestSuite) TestPendingRequestExpirationNoLeaks() {
+	const count = 200
+	suite.state.SetSweepInterval(5 * time.Millisecond)
+	suite.state.Start()
+	defer suite.state.Stop()
+	for i := 0; i < count; i++ {
+		suite.state.AddPendingRequestWithTTL(fmt.Sprintf("req-%d", i), newMockRequest("v"), time.Millisecond)
+	}
+	suite.Require().Eventually(func() bool {
+		return !suite.state.HasPendingRequest()
+	}, time.Second, 10*time.Millisecond, "expired pending requests were not swept away")
+}
+
+// TestDeleteRacingSweepExpiryDoesNotDoubleFire races a real DeletePendingRequest against the
+// sweeper expiring the very same, about-to-expire request: a real CALLRESULT arriving at
+// (almost) the same moment its TTL elapses. Neither side should see itself as "the one that
+// removed it" unless it actually won the race, since GetPendingRequest/DeletePendingRequest/
+// sweep all ultimately share the same RequestStore.DeleteIfPresent primitive.
+func (suite *ClientStateTestSuite) TestDeleteRacingSweepExpiryDoesNotDoubleFire() {
+	const rounds = 200
+	var expiredCount int32
+	suite.state.SetSweepInterval(time.Millisecond)
+	suite.state.SetOnRequestExpired(func(requestID string, request ocpp.Request) {
+		atomic.AddInt32(&expiredCount, 1)
+	})
+	suite.state.Start()
+	defer suite.state.Stop()
+
+	for i := 0; i < rounds; i++ {
+		requestID := fmt.Sprintf("req%d", i)
+		suite.state.AddPendingRequestWithTTL(requestID, newMockRequest("v"), time.Millisecond)
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			time.Sleep(time.Millisecond)
+			suite.state.DeletePendingRequest(requestID)
+		}()
+		wg.Wait()
+	}
+
+	suite.Require().Eventually(func() bool {
+		return !suite.state.HasPendingRequest()
+	}, time.Second, 10*time.Millisecond, "expired pending requests were not swept away")
+	suite.LessOrEqual(int(atomic.LoadInt32(&expiredCount)), rounds)
+}
+
+// TestQueueModeDeleteRacingSweepExpiryReleasesSlotOnce is the queue-mode counterpart of
+// TestDeleteRacingSweepExpiryDoesNotDoubleFire: it proves that a DeletePendingRequest racing
+// a sweep of the same request never releases the in-flight slot twice. A spurious second
+// release would incorrectly decrement inFlightCount a second time, losing track of the
+// request that was legitimately promoted into that slot and letting a further
+// AddPendingRequest exceed maxDepth.
+func (suite *ClientStateTestSuite) TestQueueModeDeleteRacingSweepExpiryReleasesSlotOnce() {
+	suite.state = ocppj.NewClientStateWithQueue(1)
+	suite.state.SetSweepInterval(time.Millisecond)
+	suite.state.Start()
+	defer suite.state.Stop()
+
+	const rounds = 200
+	for i := 0; i < rounds; i++ {
+		inFlightID := fmt.Sprintf("inflight%d", i)
+		waiterID := fmt.Sprintf("waiter%d", i)
+		suite.state.AddPendingRequestWithTTL(inFlightID, newMockRequest("v"), time.Millisecond)
+		suite.state.AddPendingRequest(waiterID, newMockRequest("v"))
+		suite.Require().True(suite.state.Full())
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			time.Sleep(time.Millisecond)
+			suite.state.DeletePendingRequest(inFlightID)
+		}()
+		wg.Wait()
+
+		// Exactly one slot was freed and exactly one request (the waiter) should have taken
+		// it: QueueDepth dropping to 0 here would mean a spurious extra release silently lost
+		// track of an in-flight request, breaking the maxDepth guarantee.
+		suite.Require().Eventually(func() bool {
+			return suite.state.QueueDepth() == 1
+		}, time.Second, 10*time.Millisecond, "queue depth did not settle at exactly 1 in-flight request")
+		suite.True(suite.state.Full())
+		suite.state.DeletePendingRequest(waiterID)
+		suite.Require().Equal(0, suite.state.QueueDepth())
+	}
+}
+
+func TestClientStateWithCustomStore(t *testing.T) {
+	store := ocppj.NewMemoryRequestStore()
+	state := ocppj.NewClientStateWithStore(store)
+	req := newMockRequest("somevalue")
+	state.AddPendingRequest("1234", req)
+
+	// The same request is visible directly through the backing store.
+	entry, ok, err := store.Load("", "1234")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, req, entry.Request)
+}
+
 type ServerStateTestSuite struct {
 	suite.Suite
 	mutex sync.RWMutex
@@ -206,3 +378,161 @@ func (suite *ServerStateTestSuite) TestDeleteInvalidPendingRequest() {
 	suite.True(exists)
 	suite.NotNil(r)
 }
+
+func (suite *ServerStateTestSuite) TestPendingRequestExpiration() {
+	client1 := "client1"
+	type expiredRequest struct {
+		clientID  string
+		requestID string
+	}
+	expired := make(chan expiredRequest, 1)
+	suite.state.SetSweepInterval(10 * time.Millisecond)
+	suite.state.SetOnRequestExpired(func(clientID, requestID string, request ocpp.Request) {
+		expired <- expiredRequest{clientID, requestID}
+	})
+	suite.state.Start()
+	defer suite.state.Stop()
+	suite.state.AddPendingRequestWithTTL(client1, "1234", newMockRequest("somevalue"), 20*time.Millisecond)
+
+	select {
+	case e := <-expired:
+		suite.Equal(client1, e.clientID)
+		suite.Equal("1234", e.requestID)
+	case <-time.After(time.Second):
+		suite.Fail("expiration callback was never invoked")
+	}
+	suite.False(suite.state.HasPendingRequest(client1))
+}
+
+// TestClearAllPendingRequestsDuringSweep ensures that ClearAllPendingRequests, which may
+// run concurrently with the sweeper goroutine and with additions, never causes a sweep to
+// panic and leaves no pending requests behind once a final clear has run.
+func (suite *ServerStateTestSuite) TestClearAllPendingRequestsDuringSweep() {
+	suite.state.SetSweepInterval(time.Millisecond)
+	suite.state.Start()
+	defer suite.state.Stop()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	stop := make(chan struct{})
+	go func() {
+		defer wg.Done()
+		i := 0
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				clientID := fmt.Sprintf("client%d", i%10)
+				suite.state.AddPendingRequestWithTTL(clientID, fmt.Sprintf("req%d", i), newMockRequest("v"), time.Millisecond)
+				i++
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			suite.state.ClearAllPendingRequests()
+		}
+		close(stop)
+	}()
+	wg.Wait()
+
+	suite.state.ClearAllPendingRequests()
+	suite.False(suite.state.HasPendingRequests())
+}
+
+func TestServerStateWithCustomStore(t *testing.T) {
+	store := ocppj.NewMemoryRequestStore()
+	state := ocppj.NewServerStateWithStore(store, nil)
+	req := newMockRequest("somevalue")
+	state.AddPendingRequest("client1", "1234", req)
+
+	// The same request is visible directly through the backing store, namespaced by clientID.
+	entry, ok, err := store.Load("client1", "1234")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, req, entry.Request)
+}
+
+func TestClientStateQueueFIFOOrdering(t *testing.T) {
+	state := ocppj.NewClientStateWithQueue(1)
+	var dequeued []string
+	state.SetOnRequestDequeued(func(requestID string, request ocpp.Request) {
+		dequeued = append(dequeued, requestID)
+	})
+
+	state.AddPendingRequest("1", newMockRequest("v1"))
+	require.True(t, state.Full())
+	state.AddPendingRequest("2", newMockRequest("v2"))
+	state.AddPendingRequest("3", newMockRequest("v3"))
+	assert.Equal(t, 3, state.QueueDepth())
+
+	// Responses interleave with further additions; requests must still leave the queue in
+	// the order they were added.
+	state.DeletePendingRequest("1")
+	state.AddPendingRequest("4", newMockRequest("v4"))
+	state.DeletePendingRequest("2")
+	state.DeletePendingRequest("3")
+	state.DeletePendingRequest("4")
+
+	assert.Equal(t, []string{"2", "3", "4"}, dequeued)
+	assert.Equal(t, 0, state.QueueDepth())
+	assert.False(t, state.Full())
+}
+
+func TestClientStateQueueFullHook(t *testing.T) {
+	state := ocppj.NewClientStateWithQueue(1)
+	var full []string
+	state.SetOnQueueFull(func(requestID string, request ocpp.Request) {
+		full = append(full, requestID)
+	})
+	state.AddPendingRequest("1", newMockRequest("v1"))
+	state.AddPendingRequest("2", newMockRequest("v2"))
+	state.AddPendingRequest("3", newMockRequest("v3"))
+	assert.Equal(t, []string{"2", "3"}, full)
+}
+
+func (suite *ServerStateTestSuite) TestQueueModeClearDropsBufferedRequests() {
+	suite.state = ocppj.NewServerStateWithQueue(1, &suite.mutex)
+	client1 := "client1"
+	var dropped []string
+	suite.state.SetOnRequestDropped(func(clientID, requestID string, request ocpp.Request) {
+		suite.Equal(client1, clientID)
+		dropped = append(dropped, requestID)
+	})
+
+	suite.state.AddPendingRequest(client1, "1", newMockRequest("v1"))
+	suite.state.AddPendingRequest(client1, "2", newMockRequest("v2"))
+	suite.state.AddPendingRequest(client1, "3", newMockRequest("v3"))
+	suite.Require().Equal(3, suite.state.QueueDepth(client1))
+
+	suite.state.ClearClientPendingRequest(client1)
+	suite.Equal([]string{"2", "3"}, dropped)
+	suite.Equal(0, suite.state.QueueDepth(client1))
+	suite.False(suite.state.HasPendingRequest(client1))
+}
+
+func (suite *ServerStateTestSuite) TestQueueModeConcurrentStress() {
+	suite.state = ocppj.NewServerStateWithQueue(4, &suite.mutex)
+	const clients = 100
+	const perClient = 100
+
+	var wg sync.WaitGroup
+	for c := 0; c < clients; c++ {
+		wg.Add(1)
+		go func(clientID string) {
+			defer wg.Done()
+			for i := 0; i < perClient; i++ {
+				requestID := fmt.Sprintf("req%d", i)
+				suite.state.AddPendingRequest(clientID, requestID, newMockRequest("v"))
+				suite.state.DeletePendingRequest(clientID, requestID)
+			}
+		}(fmt.Sprintf("client%d", c))
+	}
+	wg.Wait()
+
+	for c := 0; c < clients; c++ {
+		suite.Equal(0, suite.state.QueueDepth(fmt.Sprintf("client%d", c)))
+	}
+}
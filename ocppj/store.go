@@ -0,0 +1,156 @@
+package ocppj
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/lorenzodonini/ocpp-go/ocpp"
+)
+
+// StoredRequest is the durable representation of a single pending CALL, as persisted by a
+// RequestStore. Action and Payload are computed once, at insertion time, so that a
+// RequestStore backed by a remote system never needs to know how to marshal/unmarshal
+// concrete ocpp.Request types: a restarting central system can inspect them to decide
+// whether to still accept a late CALLRESULT/CALLERROR for a request it issued before
+// crashing, or reject it with a CallError.
+//
+// Request holds the original ocpp.Request value. It is always populated for entries
+// served by the default in-memory store, but a RequestStore backed by a remote system may
+// leave it nil after a process restart, since it has no way of reconstructing a concrete
+// ocpp.Request from Action and Payload alone.
+type StoredRequest struct {
+	ClientID  string
+	RequestID string
+	Action    string
+	Payload   json.RawMessage
+	Timestamp time.Time
+	ExpiresAt time.Time
+	HasExpiry bool
+	// TTL is the duration ExpiresAt was originally computed from. It is kept alongside
+	// ExpiresAt so that refreshing an entry's expiry on access (see ClientState.
+	// SetRefreshOnAccess) can extend it by the TTL it actually has, rather than some
+	// unrelated state-level default.
+	TTL time.Duration
+	// Request is deliberately excluded from JSON (de)serialization: a RequestStore backed by
+	// a remote system has no way of reconstructing a concrete ocpp.Request from Action and
+	// Payload alone, so it is only ever set for entries handled in-process.
+	Request ocpp.Request `json:"-"`
+}
+
+func (e StoredRequest) expired(now time.Time) bool {
+	return e.HasExpiry && !now.Before(e.ExpiresAt)
+}
+
+// NewStoredRequest builds the StoredRequest to persist for the given clientID/requestID
+// pair, marshaling request's payload and extracting its OCPP action name.
+func NewStoredRequest(clientID string, requestID string, request ocpp.Request) (StoredRequest, error) {
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return StoredRequest{}, err
+	}
+	return StoredRequest{
+		ClientID:  clientID,
+		RequestID: requestID,
+		Action:    request.GetFeatureName(),
+		Payload:   payload,
+		Timestamp: time.Now(),
+		Request:   request,
+	}, nil
+}
+
+// RequestStore is the persistence extension point for pending request state. It allows
+// ClientState/ServerState to keep track of pending CALLs outside of process memory, so that
+// they can survive a restart or be shared across a horizontally scaled CSMS.
+//
+// Implementations must be safe for concurrent use.
+type RequestStore interface {
+	// Save persists entry, overwriting any previous entry for the same ClientID/RequestID.
+	Save(entry StoredRequest) error
+	// Load retrieves the entry previously saved for the given clientID/requestID pair. The
+	// second return value is false if no such entry exists.
+	Load(clientID string, requestID string) (StoredRequest, bool, error)
+	// Delete removes the entry for the given clientID/requestID pair, if any. Deleting a
+	// non-existing entry is not an error.
+	Delete(clientID string, requestID string) error
+	// DeleteIfPresent atomically removes the entry for the given clientID/requestID pair and
+	// reports whether an entry was actually there to remove. Callers that must react only
+	// when they are the ones who actually claimed the entry (e.g. releasing a queue slot, or
+	// firing an expiration callback) should use this instead of a separate Load+Delete,
+	// which would race against a concurrent Delete/DeleteIfPresent for the same pair.
+	DeleteIfPresent(clientID string, requestID string) (bool, error)
+	// IterateByClient invokes fn once for every entry currently stored for clientID. Iteration
+	// stops early if fn returns false.
+	IterateByClient(clientID string, fn func(StoredRequest) bool) error
+}
+
+// memoryRequestStore is the default in-memory RequestStore implementation.
+type memoryRequestStore struct {
+	mutex   sync.RWMutex
+	entries map[string]map[string]StoredRequest // clientID -> requestID -> entry
+}
+
+// NewMemoryRequestStore creates a RequestStore backed by a plain Go map. This is the
+// default store used by NewClientState and NewServerState.
+func NewMemoryRequestStore() RequestStore {
+	return &memoryRequestStore{entries: map[string]map[string]StoredRequest{}}
+}
+
+func (s *memoryRequestStore) Save(entry StoredRequest) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	client, ok := s.entries[entry.ClientID]
+	if !ok {
+		client = map[string]StoredRequest{}
+		s.entries[entry.ClientID] = client
+	}
+	client[entry.RequestID] = entry
+	return nil
+}
+
+func (s *memoryRequestStore) Load(clientID string, requestID string) (StoredRequest, bool, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	client, ok := s.entries[clientID]
+	if !ok {
+		return StoredRequest{}, false, nil
+	}
+	entry, ok := client[requestID]
+	return entry, ok, nil
+}
+
+func (s *memoryRequestStore) Delete(clientID string, requestID string) error {
+	_, err := s.DeleteIfPresent(clientID, requestID)
+	return err
+}
+
+func (s *memoryRequestStore) DeleteIfPresent(clientID string, requestID string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	client, ok := s.entries[clientID]
+	if !ok {
+		return false, nil
+	}
+	if _, ok := client[requestID]; !ok {
+		return false, nil
+	}
+	delete(client, requestID)
+	return true, nil
+}
+
+func (s *memoryRequestStore) IterateByClient(clientID string, fn func(StoredRequest) bool) error {
+	s.mutex.RLock()
+	client := s.entries[clientID]
+	entries := make([]StoredRequest, 0, len(client))
+	for _, entry := range client {
+		entries = append(entries, entry)
+	}
+	s.mutex.RUnlock()
+
+	for _, entry := range entries {
+		if !fn(entry) {
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+// Package bolt provides a BoltDB-backed ocppj.RequestStore, so that pending CALLs can
+// survive a process restart without requiring any external service.
+package bolt
+
+import (
+	"encoding/json"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/lorenzodonini/ocpp-go/ocppj"
+)
+
+// DefaultBucketName is the top-level BoltDB bucket Store keeps its entries in.
+const DefaultBucketName = "ocppj_pending_requests"
+
+// Store is an ocppj.RequestStore backed by a BoltDB file. Entries are keyed by
+// "<len(clientID)>:<clientID>/<requestID>" inside a single bucket, so that IterateByClient
+// can use a cursor prefix scan instead of loading the whole bucket. The clientID length
+// prefix is what makes the key unambiguous: without it, clientID "a" + requestID "b/1" and
+// clientID "a/b" + requestID "1" would both produce the key "a/b/1".
+type Store struct {
+	db         *bolt.DB
+	bucketName []byte
+}
+
+// NewStore creates a Store backed by db, creating its bucket if it doesn't exist yet.
+func NewStore(db *bolt.DB) (*Store, error) {
+	s := &Store{db: db, bucketName: []byte(DefaultBucketName)}
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(s.bucketName)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func clientPrefix(clientID string) []byte {
+	return []byte(fmt.Sprintf("%d:%s/", len(clientID), clientID))
+}
+
+func entryKey(clientID string, requestID string) []byte {
+	return append(clientPrefix(clientID), []byte(requestID)...)
+}
+
+func (s *Store) Save(entry ocppj.StoredRequest) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(s.bucketName).Put(entryKey(entry.ClientID, entry.RequestID), data)
+	})
+}
+
+func (s *Store) Load(clientID string, requestID string) (ocppj.StoredRequest, bool, error) {
+	var entry ocppj.StoredRequest
+	found := false
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(s.bucketName).Get(entryKey(clientID, requestID))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, &entry)
+	})
+	if err != nil {
+		return ocppj.StoredRequest{}, false, err
+	}
+	return entry, found, nil
+}
+
+func (s *Store) Delete(clientID string, requestID string) error {
+	_, err := s.DeleteIfPresent(clientID, requestID)
+	return err
+}
+
+// DeleteIfPresent atomically checks for and removes the entry for clientID/requestID within a
+// single BoltDB transaction, so that a concurrent caller racing to remove the same entry
+// (e.g. a real CALLRESULT handler racing against the sweeper) can never both observe it as
+// present.
+func (s *Store) DeleteIfPresent(clientID string, requestID string) (bool, error) {
+	found := false
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(s.bucketName)
+		key := entryKey(clientID, requestID)
+		if bucket.Get(key) == nil {
+			return nil
+		}
+		found = true
+		return bucket.Delete(key)
+	})
+	if err != nil {
+		return false, err
+	}
+	return found, nil
+}
+
+func (s *Store) IterateByClient(clientID string, fn func(ocppj.StoredRequest) bool) error {
+	prefix := clientPrefix(clientID)
+	return s.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(s.bucketName).Cursor()
+		for k, v := cursor.Seek(prefix); k != nil && hasPrefix(k, prefix); k, v = cursor.Next() {
+			var entry ocppj.StoredRequest
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return err
+			}
+			if !fn(entry) {
+				break
+			}
+		}
+		return nil
+	})
+}
+
+func hasPrefix(b []byte, prefix []byte) bool {
+	return len(b) >= len(prefix) && string(b[:len(prefix)]) == string(prefix)
+}
@@ -0,0 +1,28 @@
+package bolt_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	boltdb "go.etcd.io/bbolt"
+
+	"github.com/lorenzodonini/ocpp-go/ocppj"
+	"github.com/lorenzodonini/ocpp-go/ocppj/store/bolt"
+	"github.com/lorenzodonini/ocpp-go/ocppj/storetest"
+)
+
+func TestStore(t *testing.T) {
+	storetest.RunConformanceTests(t, func(t *testing.T) ocppj.RequestStore {
+		db, err := boltdb.Open(filepath.Join(t.TempDir(), "ocppj.db"), 0600, &boltdb.Options{Timeout: time.Second})
+		if err != nil {
+			t.Fatalf("failed to open bolt db: %v", err)
+		}
+		t.Cleanup(func() { _ = db.Close() })
+		store, err := bolt.NewStore(db)
+		if err != nil {
+			t.Fatalf("failed to create bolt store: %v", err)
+		}
+		return store
+	})
+}
@@ -0,0 +1,121 @@
+// Package redis provides a Redis-backed ocppj.RequestStore, so that pending CALLs can
+// survive a process restart or be shared across a horizontally scaled CSMS.
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/lorenzodonini/ocpp-go/ocppj"
+)
+
+// DefaultKeyPrefix is prepended to every Redis key written by Store, to avoid colliding
+// with unrelated keys in a shared Redis instance.
+const DefaultKeyPrefix = "ocppj:pending:"
+
+// Store is an ocppj.RequestStore backed by Redis. Every pending request is stored as a JSON
+// value under a key derived from its clientID and requestID; the set of requestIDs pending
+// for a given client is tracked separately, to support IterateByClient without a KEYS scan.
+type Store struct {
+	client    redis.UniversalClient
+	keyPrefix string
+	ctx       context.Context
+}
+
+// NewStore creates a Store backed by the given Redis client. The client is expected to
+// already be configured and connected; Store does not take ownership of it.
+func NewStore(client redis.UniversalClient) *Store {
+	return &Store{client: client, keyPrefix: DefaultKeyPrefix, ctx: context.Background()}
+}
+
+// encodeComponent netstring-encodes s (length-prefixed) so that concatenating encoded
+// components into a single key can never produce the same string for two different
+// clientID/requestID pairs, even when either value contains the ':' or '/' characters used
+// elsewhere as separators. Charging station IDs are operator-assigned and not guaranteed to
+// be delimiter-free.
+func encodeComponent(s string) string {
+	return fmt.Sprintf("%d:%s", len(s), s)
+}
+
+func (s *Store) entryKey(clientID string, requestID string) string {
+	return s.keyPrefix + "entry:" + encodeComponent(clientID) + encodeComponent(requestID)
+}
+
+func (s *Store) clientSetKey(clientID string) string {
+	return s.keyPrefix + "client:" + encodeComponent(clientID)
+}
+
+func (s *Store) Save(entry ocppj.StoredRequest) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	pipe := s.client.TxPipeline()
+	pipe.Set(s.ctx, s.entryKey(entry.ClientID, entry.RequestID), data, 0)
+	pipe.SAdd(s.ctx, s.clientSetKey(entry.ClientID), entry.RequestID)
+	_, err = pipe.Exec(s.ctx)
+	return err
+}
+
+func (s *Store) Load(clientID string, requestID string) (ocppj.StoredRequest, bool, error) {
+	data, err := s.client.Get(s.ctx, s.entryKey(clientID, requestID)).Bytes()
+	if err == redis.Nil {
+		return ocppj.StoredRequest{}, false, nil
+	}
+	if err != nil {
+		return ocppj.StoredRequest{}, false, err
+	}
+	var entry ocppj.StoredRequest
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return ocppj.StoredRequest{}, false, err
+	}
+	return entry, true, nil
+}
+
+func (s *Store) Delete(clientID string, requestID string) error {
+	_, err := s.DeleteIfPresent(clientID, requestID)
+	return err
+}
+
+// DeleteIfPresent atomically removes the entry for clientID/requestID via GETDEL, so that a
+// concurrent caller racing to remove the same entry (e.g. a real CALLRESULT handler racing
+// against the sweeper) can never both observe it as present. SRem always runs afterwards,
+// even when the entry was already gone, so that a membership left stale by a crash between
+// a prior Save and its matching removal still gets cleaned up.
+func (s *Store) DeleteIfPresent(clientID string, requestID string) (bool, error) {
+	_, err := s.client.GetDel(s.ctx, s.entryKey(clientID, requestID)).Result()
+	if err != nil && err != redis.Nil {
+		return false, err
+	}
+	existed := err == nil
+	if err := s.client.SRem(s.ctx, s.clientSetKey(clientID), requestID).Err(); err != nil {
+		return existed, err
+	}
+	return existed, nil
+}
+
+func (s *Store) IterateByClient(clientID string, fn func(ocppj.StoredRequest) bool) error {
+	requestIDs, err := s.client.SMembers(s.ctx, s.clientSetKey(clientID)).Result()
+	if err != nil {
+		return err
+	}
+	for _, requestID := range requestIDs {
+		entry, ok, err := s.Load(clientID, requestID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			// The entry was deleted since SMembers ran, or its membership is stale; skip it.
+			// A stale membership is only removed by a later Delete/DeleteIfPresent for this
+			// same requestID.
+			continue
+		}
+		if !fn(entry) {
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package redis_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	"github.com/lorenzodonini/ocpp-go/ocppj"
+	"github.com/lorenzodonini/ocpp-go/ocppj/store/redis"
+	"github.com/lorenzodonini/ocpp-go/ocppj/storetest"
+)
+
+// TestStore exercises the Redis-backed store against a real Redis instance. It is skipped
+// unless OCPPJ_TEST_REDIS_URL is set (it fails if the instance it points at is unreachable), since it is the only backend
+// in this package that isn't self-contained.
+func TestStore(t *testing.T) {
+	url := os.Getenv("OCPPJ_TEST_REDIS_URL")
+	if url == "" {
+		t.Skip("OCPPJ_TEST_REDIS_URL not set, skipping redis store conformance tests")
+	}
+	opts, err := goredis.ParseURL(url)
+	if err != nil {
+		t.Fatalf("invalid OCPPJ_TEST_REDIS_URL: %v", err)
+	}
+
+	storetest.RunConformanceTests(t, func(t *testing.T) ocppj.RequestStore {
+		client := goredis.NewClient(opts)
+		t.Cleanup(func() {
+			_ = client.FlushDB(context.Background()).Err()
+			_ = client.Close()
+		})
+		return redis.NewStore(client)
+	})
+}
@@ -0,0 +1,163 @@
+// Package storetest provides a conformance test suite shared by every ocppj.RequestStore
+// backend, so that ocppj/store/redis, ocppj/store/bolt (and any future backend) all get
+// exercised against the exact same behavioral assertions.
+package storetest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lorenzodonini/ocpp-go/ocppj"
+)
+
+// MockRequest is a minimal ocpp.Request implementation, good enough to be marshaled to JSON
+// and to carry a feature name through a RequestStore round-trip.
+type MockRequest struct {
+	MockValue string `json:"mockValue"`
+}
+
+func (r *MockRequest) GetFeatureName() string {
+	return "Mock"
+}
+
+// RunConformanceTests runs the full RequestStore conformance suite against a fresh store,
+// obtained by calling newStore before every test case.
+func RunConformanceTests(t *testing.T, newStore func(t *testing.T) ocppj.RequestStore) {
+	t.Run("SaveAndLoad", func(t *testing.T) {
+		store := newStore(t)
+		entry, err := ocppj.NewStoredRequest("client1", "1234", &MockRequest{MockValue: "somevalue"})
+		require.NoError(t, err)
+		require.NoError(t, store.Save(entry))
+
+		loaded, ok, err := store.Load("client1", "1234")
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, "Mock", loaded.Action)
+		require.JSONEq(t, `{"mockValue":"somevalue"}`, string(loaded.Payload))
+	})
+
+	t.Run("LoadMissing", func(t *testing.T) {
+		store := newStore(t)
+		_, ok, err := store.Load("client1", "does-not-exist")
+		require.NoError(t, err)
+		require.False(t, ok)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		store := newStore(t)
+		entry, err := ocppj.NewStoredRequest("client1", "1234", &MockRequest{MockValue: "v"})
+		require.NoError(t, err)
+		require.NoError(t, store.Save(entry))
+		require.NoError(t, store.Delete("client1", "1234"))
+
+		_, ok, err := store.Load("client1", "1234")
+		require.NoError(t, err)
+		require.False(t, ok)
+
+		// Deleting again, or deleting a never-saved entry, is not an error.
+		require.NoError(t, store.Delete("client1", "1234"))
+		require.NoError(t, store.Delete("client1", "5678"))
+	})
+
+	t.Run("DeleteIfPresent", func(t *testing.T) {
+		store := newStore(t)
+		entry, err := ocppj.NewStoredRequest("client1", "1234", &MockRequest{MockValue: "v"})
+		require.NoError(t, err)
+		require.NoError(t, store.Save(entry))
+
+		removed, err := store.DeleteIfPresent("client1", "1234")
+		require.NoError(t, err)
+		require.True(t, removed)
+
+		_, ok, err := store.Load("client1", "1234")
+		require.NoError(t, err)
+		require.False(t, ok)
+
+		// A second call for the same, now-missing pair must report false, not an error: this
+		// is what lets a caller tell a genuine removal apart from a no-op one.
+		removed, err = store.DeleteIfPresent("client1", "1234")
+		require.NoError(t, err)
+		require.False(t, removed)
+
+		removed, err = store.DeleteIfPresent("client1", "never-saved")
+		require.NoError(t, err)
+		require.False(t, removed)
+	})
+
+	t.Run("KeysDoNotCollideAcrossDelimiters", func(t *testing.T) {
+		store := newStore(t)
+		entryA, err := ocppj.NewStoredRequest("a", "b:1234", &MockRequest{MockValue: "va"})
+		require.NoError(t, err)
+		entryB, err := ocppj.NewStoredRequest("a:b", "1234", &MockRequest{MockValue: "vb"})
+		require.NoError(t, err)
+		require.NoError(t, store.Save(entryA))
+		require.NoError(t, store.Save(entryB))
+
+		loadedA, ok, err := store.Load("a", "b:1234")
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.JSONEq(t, `{"mockValue":"va"}`, string(loadedA.Payload))
+
+		loadedB, ok, err := store.Load("a:b", "1234")
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.JSONEq(t, `{"mockValue":"vb"}`, string(loadedB.Payload))
+	})
+
+	t.Run("IterateByClient", func(t *testing.T) {
+		store := newStore(t)
+		entry1, err := ocppj.NewStoredRequest("client1", "1234", &MockRequest{MockValue: "v1"})
+		require.NoError(t, err)
+		entry2, err := ocppj.NewStoredRequest("client1", "5678", &MockRequest{MockValue: "v2"})
+		require.NoError(t, err)
+		entry3, err := ocppj.NewStoredRequest("client2", "0001", &MockRequest{MockValue: "v3"})
+		require.NoError(t, err)
+		require.NoError(t, store.Save(entry1))
+		require.NoError(t, store.Save(entry2))
+		require.NoError(t, store.Save(entry3))
+
+		var seen []string
+		err = store.IterateByClient("client1", func(e ocppj.StoredRequest) bool {
+			seen = append(seen, e.RequestID)
+			return true
+		})
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{"1234", "5678"}, seen)
+	})
+
+	t.Run("IterateByClientStopsEarly", func(t *testing.T) {
+		store := newStore(t)
+		entry1, err := ocppj.NewStoredRequest("client1", "1234", &MockRequest{MockValue: "v1"})
+		require.NoError(t, err)
+		entry2, err := ocppj.NewStoredRequest("client1", "5678", &MockRequest{MockValue: "v2"})
+		require.NoError(t, err)
+		require.NoError(t, store.Save(entry1))
+		require.NoError(t, store.Save(entry2))
+
+		count := 0
+		err = store.IterateByClient("client1", func(e ocppj.StoredRequest) bool {
+			count++
+			return false
+		})
+		require.NoError(t, err)
+		require.Equal(t, 1, count)
+	})
+
+	t.Run("SaveOverwrites", func(t *testing.T) {
+		store := newStore(t)
+		entry, err := ocppj.NewStoredRequest("client1", "1234", &MockRequest{MockValue: "v1"})
+		require.NoError(t, err)
+		require.NoError(t, store.Save(entry))
+
+		entry.Timestamp = entry.Timestamp.Add(time.Second)
+		entry.Payload = []byte(`{"mockValue":"v2"}`)
+		require.NoError(t, store.Save(entry))
+
+		loaded, ok, err := store.Load("client1", "1234")
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.JSONEq(t, `{"mockValue":"v2"}`, string(loaded.Payload))
+	})
+}